@@ -0,0 +1,351 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+This file turns Warnable state transitions into structured, subscribable
+Events, and provides a webhook Sink so fleets can forward them to external
+alerting without polling `tailscale status`.
+*/
+
+// Event describes a single change in a Warnable's health state: a transition
+// between healthy and unhealthy, or vice versa, or an update to its
+// UnhealthyState while it stays unhealthy (a repeated SetUnhealthy, or a
+// recorded remediation attempt).
+type Event struct {
+	// Seq is a monotonically increasing sequence number, unique per Tracker,
+	// that lets subscribers detect gaps or reorder events.
+	Seq uint64 `json:"seq"`
+
+	// Time is when the transition was observed.
+	Time time.Time `json:"time"`
+
+	// Code is the Warnable's code.
+	Code WarnableCode `json:"code"`
+
+	// Unhealthy reports whether the Warnable became active (true) or
+	// resolved (false) at Time.
+	Unhealthy bool `json:"unhealthy"`
+
+	// Severity is the Warnable's severity. It is the zero Severity when
+	// Unhealthy is false.
+	Severity Severity `json:"severity,omitempty"`
+
+	// ImpactsConnectivity reports whether the Warnable affects the node's
+	// ability to connect.
+	ImpactsConnectivity bool `json:"impactsConnectivity,omitempty"`
+
+	// DependsOn lists the codes of other Warnables this one depends on.
+	DependsOn []WarnableCode `json:"dependsOn,omitempty"`
+
+	// Text is the resolved, human-readable warning text. It is empty when
+	// Unhealthy is false.
+	Text string `json:"text,omitempty"`
+
+	// Args is the set of arguments that Text was rendered from.
+	Args Args `json:"args,omitempty"`
+
+	// RemediationAttempts, RemediationLastErr and RemediationEscalated
+	// mirror the same fields on UnhealthyState, so subscribers see
+	// self-remediation attempts/outcomes without polling separately.
+	RemediationAttempts  int    `json:"remediationAttempts,omitempty"`
+	RemediationLastErr   string `json:"remediationLastErr,omitempty"`
+	RemediationEscalated bool   `json:"remediationEscalated,omitempty"`
+}
+
+// eventBus fans out Events for a single Tracker to subscribers, assigning
+// each Event a sequence number. Its lifetime is tied to the Tracker that
+// owns it (see Tracker.eventBus), so it never outlives the Tracker.
+type eventBus struct {
+	seq atomic.Uint64
+
+	mu   sync.Mutex
+	subs map[*eventSub]bool
+}
+
+type eventSub struct {
+	fn func(Event)
+}
+
+func (b *eventBus) onChange(w *Warnable, us *UnhealthyState) {
+	ev := Event{
+		Seq:       b.seq.Add(1),
+		Time:      time.Now(),
+		Code:      w.Code,
+		Unhealthy: us != nil,
+	}
+	if us != nil {
+		ev.Severity = us.Severity
+		ev.ImpactsConnectivity = us.ImpactsConnectivity
+		ev.DependsOn = us.DependsOn
+		ev.Text = us.Text
+		ev.Args = us.Args
+		ev.RemediationAttempts = us.RemediationAttempts
+		ev.RemediationLastErr = us.RemediationLastErr
+		ev.RemediationEscalated = us.RemediationEscalated
+	}
+
+	b.mu.Lock()
+	subs := make([]*eventSub, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.fn(ev)
+	}
+}
+
+func (b *eventBus) subscribe(fn func(Event)) (unregister func()) {
+	s := &eventSub{fn: fn}
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[*eventSub]bool)
+	}
+	b.subs[s] = true
+	b.mu.Unlock()
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, s)
+		b.mu.Unlock()
+	}
+}
+
+func (t *Tracker) bus() *eventBus {
+	t.eventsOnce.Do(func() {
+		t.eventBus = &eventBus{}
+		t.RegisterWatcher(t.eventBus.onChange)
+	})
+	return t.eventBus
+}
+
+// Subscribe registers fn to be called with a structured Event every time one
+// of t's Warnables transitions between healthy and unhealthy, and every time
+// the UnhealthyState of an active Warnable is updated. The returned
+// func removes the subscription; callers should invoke it once they no
+// longer want events delivered. fn is called synchronously from the
+// goroutine that reported the transition, so it must not block or re-enter
+// the Tracker.
+func (t *Tracker) Subscribe(fn func(Event)) (unregister func()) {
+	return t.bus().subscribe(fn)
+}
+
+// SeverityAtLeast reports whether a is at least as severe as b.
+func SeverityAtLeast(a, b Severity) bool {
+	return severityRank(a) >= severityRank(b)
+}
+
+func severityRank(s Severity) int {
+	switch s {
+	case SeverityHigh:
+		return 2
+	case SeverityMedium:
+		return 1
+	case SeverityLow:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// WebhookConfig configures a webhook Sink.
+type WebhookConfig struct {
+	// URL is the endpoint Events are POSTed to as JSON.
+	URL string
+
+	// Secret, if non-empty, is used to HMAC-SHA256 sign each request body;
+	// the signature is sent in the X-Tailscale-Signature header as a
+	// hex-encoded digest, so receivers can verify authenticity.
+	Secret []byte
+
+	// MinSeverity filters out unhealthy Events below this severity. The
+	// zero value defaults to SeverityHigh, matching the common case of only
+	// forwarding SeverityHigh and ImpactsConnectivity events; set it
+	// explicitly to SeverityLow to forward everything. Events with a zero
+	// Severity (i.e. "resolved" events) are not filtered by MinSeverity;
+	// a resolution is forwarded only if the code's most recent activation
+	// was forwarded.
+	MinSeverity Severity
+
+	// RequireConnectivity, if true, forwards only Events whose
+	// ImpactsConnectivity is true, regardless of MinSeverity.
+	RequireConnectivity bool
+
+	// MaxAttempts is the total number of delivery attempts (the first try
+	// plus retries) before an Event is dropped. Zero means a single attempt
+	// with no retries.
+	MaxAttempts int
+
+	// QueueSize bounds how many Events may be queued for delivery at once.
+	// Zero means a reasonable default. Once full, further Events are
+	// dropped rather than spawning unbounded concurrent deliveries; a
+	// flapping Warnable should not be able to pile up goroutines.
+	QueueSize int
+
+	// Client is used to make the HTTP request. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+}
+
+const defaultWebhookQueueSize = 64
+
+// WebhookSink delivers Events matching its WebhookConfig to an HTTP endpoint,
+// signing each payload and retrying transient failures with backoff. A
+// single worker goroutine processes its queue, so deliveries for a given
+// sink happen one at a time and in Seq order.
+//
+// This is meant to replace ad-hoc callers that currently just log a line
+// when e.g. derpTimeoutWarnable or controlHealthWarnable fire. Those call
+// sites live in magicsock/derphttp/control, none of which are part of this
+// tree, so wiring an actual WebhookSink up to a running Tracker is left to
+// whichever subsystem owns node startup (construct one with NewWebhookSink
+// and call Attach on the node's Tracker).
+type WebhookSink struct {
+	cfg   WebhookConfig
+	once  sync.Once
+	queue chan Event
+
+	mu        sync.Mutex
+	forwarded map[WarnableCode]bool // codes whose most recent activation was forwarded
+}
+
+// NewWebhookSink returns a WebhookSink for cfg.
+func NewWebhookSink(cfg WebhookConfig) *WebhookSink {
+	return &WebhookSink{cfg: cfg}
+}
+
+func (s *WebhookSink) minSeverity() Severity {
+	if s.cfg.MinSeverity == "" {
+		return SeverityHigh
+	}
+	return s.cfg.MinSeverity
+}
+
+func (s *WebhookSink) start() {
+	s.once.Do(func() {
+		n := s.cfg.QueueSize
+		if n <= 0 {
+			n = defaultWebhookQueueSize
+		}
+		s.queue = make(chan Event, n)
+		go s.run()
+	})
+}
+
+func (s *WebhookSink) run() {
+	for ev := range s.queue {
+		s.deliver(ev)
+	}
+}
+
+// Attach subscribes the sink to t, forwarding matching Events until the
+// returned func is called.
+func (s *WebhookSink) Attach(t *Tracker) (unregister func()) {
+	s.start()
+	return t.Subscribe(func(ev Event) {
+		if !s.shouldForward(ev) {
+			return
+		}
+		select {
+		case s.queue <- ev:
+		default:
+			// Queue is full: drop rather than let a flapping Warnable spawn
+			// unbounded concurrent deliveries or reorder events relative to
+			// their Seq.
+		}
+	})
+}
+
+// shouldForward reports whether ev passes the sink's filter. For a
+// resolution it doesn't re-apply MinSeverity/RequireConnectivity (the
+// resolution itself carries no severity); instead it forwards only if this
+// code's most recent activation was itself forwarded, so receivers never see
+// a "resolved" event for a condition they were never told went unhealthy.
+func (s *WebhookSink) shouldForward(ev Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.forwarded == nil {
+		s.forwarded = make(map[WarnableCode]bool)
+	}
+
+	if !ev.Unhealthy {
+		wasForwarded := s.forwarded[ev.Code]
+		delete(s.forwarded, ev.Code)
+		return wasForwarded
+	}
+
+	fwd := s.matchesFilter(ev)
+	if fwd {
+		s.forwarded[ev.Code] = true
+	} else {
+		delete(s.forwarded, ev.Code)
+	}
+	return fwd
+}
+
+func (s *WebhookSink) matchesFilter(ev Event) bool {
+	if s.cfg.RequireConnectivity {
+		return ev.ImpactsConnectivity
+	}
+	return SeverityAtLeast(ev.Severity, s.minSeverity())
+}
+
+func (s *WebhookSink) deliver(ev Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	client := s.cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	maxAttempts := s.cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		req, err := http.NewRequest("POST", s.cfg.URL, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(s.cfg.Secret) > 0 {
+			req.Header.Set("X-Tailscale-Signature", signBody(s.cfg.Secret, body))
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				return
+			}
+		}
+	}
+}
+
+func signBody(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,171 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscribeSeqMonotonic(t *testing.T) {
+	w := &Warnable{Code: "events-seq-test", Severity: SeverityLow}
+	tr := NewTracker()
+
+	var mu sync.Mutex
+	var seqs []uint64
+	unregister := tr.Subscribe(func(ev Event) {
+		mu.Lock()
+		seqs = append(seqs, ev.Seq)
+		mu.Unlock()
+	})
+	defer unregister()
+
+	tr.SetUnhealthy(w, Args{})
+	tr.SetHealthy(w)
+	tr.SetUnhealthy(w, Args{})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seqs) != 3 {
+		t.Fatalf("got %d events, want 3", len(seqs))
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] <= seqs[i-1] {
+			t.Fatalf("seq not monotonically increasing: %v", seqs)
+		}
+	}
+}
+
+func TestWebhookSinkSeverityFiltering(t *testing.T) {
+	low := &Warnable{Code: "webhook-low", Severity: SeverityLow}
+	high := &Warnable{Code: "webhook-high", Severity: SeverityHigh}
+	tr := NewTracker()
+
+	var received []Event
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, ev)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(WebhookConfig{URL: srv.URL, MinSeverity: SeverityHigh})
+	unregister := sink.Attach(tr)
+	defer unregister()
+
+	tr.SetUnhealthy(low, Args{})
+	tr.SetUnhealthy(high, Args{})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("got %d forwarded events, want 1 (only the SeverityHigh one): %+v", len(received), received)
+	}
+	if received[0].Code != high.Code {
+		t.Errorf("forwarded event code = %q, want %q", received[0].Code, high.Code)
+	}
+}
+
+func TestWebhookSinkSuppressesUnforwardedResolve(t *testing.T) {
+	low := &Warnable{Code: "webhook-resolve-low", Severity: SeverityLow}
+	high := &Warnable{Code: "webhook-resolve-high", Severity: SeverityHigh}
+	tr := NewTracker()
+
+	var received []Event
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, ev)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(WebhookConfig{URL: srv.URL, MinSeverity: SeverityHigh})
+	unregister := sink.Attach(tr)
+	defer unregister()
+
+	// low's activation is filtered out; its resolution must be too, since a
+	// receiver that never saw it go unhealthy shouldn't be told it resolved.
+	tr.SetUnhealthy(low, Args{})
+	tr.SetHealthy(low)
+	// high's activation passes the filter, so its resolution should too.
+	tr.SetUnhealthy(high, Args{})
+	tr.SetHealthy(high)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("got %d forwarded events, want 2 (high's activation + resolve only): %+v", len(received), received)
+	}
+	for _, ev := range received {
+		if ev.Code != high.Code {
+			t.Errorf("forwarded event for code %q, want only %q", ev.Code, high.Code)
+		}
+	}
+}
+
+func TestWebhookSinkSigningAndRetry(t *testing.T) {
+	code := WarnableCode("webhook-retry-test")
+
+	var attempts atomic.Int32
+	secret := []byte("s3cr3t")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := attempts.Add(1)
+		sig := r.Header.Get("X-Tailscale-Signature")
+		if sig == "" {
+			t.Error("missing signature header")
+		}
+		if n < 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(WebhookConfig{URL: srv.URL, Secret: secret, MinSeverity: SeverityHigh, MaxAttempts: 3})
+	sink.deliver(Event{Code: code, Unhealthy: true, Severity: SeverityHigh})
+
+	if got := attempts.Load(); got != 2 {
+		t.Fatalf("server saw %d attempts, want 2 (first 500, then success)", got)
+	}
+}
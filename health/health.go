@@ -0,0 +1,259 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/**
+This file contains the core Warnable/Tracker plumbing that the rest of this
+package (warnings.go, metrics.go, events.go, remediation.go) builds on.
+*/
+
+// WarnableCode is the stable identifier of a Warnable, e.g. "no-derp-home".
+type WarnableCode string
+
+// Severity is how serious a Warnable is.
+type Severity string
+
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+	SeverityLow    Severity = "low"
+)
+
+// ArgKey is the key of a Warnable's Args.
+type ArgKey string
+
+// Args carries the dynamic values a Warnable's Text is rendered from.
+type Args map[ArgKey]string
+
+const (
+	ArgCurrentVersion        ArgKey = "current-version"
+	ArgAvailableVersion      ArgKey = "available-version"
+	ArgError                 ArgKey = "error"
+	ArgDERPRegionName        ArgKey = "derp-region-name"
+	ArgDERPRegionID          ArgKey = "derp-region-id"
+	ArgDuration              ArgKey = "duration"
+	ArgServerName            ArgKey = "server-name"
+	ArgMagicsockFunctionName ArgKey = "magicsock-function-name"
+)
+
+// WarnableText renders a Warnable's human-readable message from its Args.
+type WarnableText func(args Args) string
+
+// StaticMessage returns a WarnableText that always renders s, for Warnables
+// whose text doesn't depend on any Args.
+func StaticMessage(s string) WarnableText {
+	return func(Args) string { return s }
+}
+
+// Warnable is a condition that a Tracker can report as healthy or unhealthy.
+type Warnable struct {
+	// Code is this Warnable's stable identifier.
+	Code WarnableCode
+
+	// Title is a short human-readable name.
+	Title string
+
+	// Severity is how serious it is for this Warnable to be active.
+	Severity Severity
+
+	// DependsOn lists other Warnables that, if active, explain this one and
+	// should be surfaced instead of (or ahead of) it.
+	DependsOn []*Warnable
+
+	// Text renders this Warnable's message from the Args it was last set
+	// unhealthy with.
+	Text WarnableText
+
+	// ImpactsConnectivity reports whether this Warnable, when active, means
+	// the node's connectivity is degraded.
+	ImpactsConnectivity bool
+
+	// Remediation, if non-nil, describes a safe, idempotent action the
+	// daemon can take (or suggest via localapi) to try to resolve this
+	// Warnable when it becomes active.
+	Remediation *Remediation
+}
+
+var (
+	warnablesMu sync.Mutex
+	warnables   = map[WarnableCode]*Warnable{}
+)
+
+// Register registers w so it can be looked up by its Code, and returns w so
+// it can be assigned directly to a package-level var. It panics if a
+// Warnable with w's Code is already registered.
+func Register(w *Warnable) *Warnable {
+	warnablesMu.Lock()
+	defer warnablesMu.Unlock()
+	if _, ok := warnables[w.Code]; ok {
+		panic(fmt.Sprintf("health: double registration of code %q", w.Code))
+	}
+	warnables[w.Code] = w
+	return w
+}
+
+// warnableByCode looks up a registered Warnable by its Code.
+func warnableByCode(code WarnableCode) (*Warnable, bool) {
+	warnablesMu.Lock()
+	defer warnablesMu.Unlock()
+	w, ok := warnables[code]
+	return w, ok
+}
+
+// registeredWarnables returns a snapshot of every Warnable registered so
+// far via Register.
+func registeredWarnables() []*Warnable {
+	warnablesMu.Lock()
+	defer warnablesMu.Unlock()
+	ws := make([]*Warnable, 0, len(warnables))
+	for _, w := range warnables {
+		ws = append(ws, w)
+	}
+	return ws
+}
+
+// UnhealthyState is a snapshot of why a Warnable is currently active.
+type UnhealthyState struct {
+	WarnableCode        WarnableCode
+	Severity            Severity
+	Title               string
+	Text                string
+	Args                Args
+	BrokenSince         time.Time
+	DependsOn           []WarnableCode
+	ImpactsConnectivity bool
+
+	// RemediationAttempts is how many times this Warnable's Remediation has
+	// been attempted since it last became active.
+	RemediationAttempts int
+	// RemediationLastErr is the error returned by the most recent
+	// remediation attempt, if any.
+	RemediationLastErr string
+	// RemediationEscalated reports whether remediation has exhausted its
+	// MaxAttempts for this activation without success.
+	RemediationEscalated bool
+}
+
+// Tracker tracks the current state of a set of Warnables for one node.
+type Tracker struct {
+	mu          sync.Mutex
+	warnableVal map[*Warnable]*UnhealthyState
+	watchers    map[*watcherHandle]func(*Warnable, *UnhealthyState)
+
+	metricsOnce      sync.Once
+	metricsCollector *metricsCollector
+
+	eventsOnce sync.Once
+	eventBus   *eventBus
+
+	remediationMu            sync.Mutex
+	remediationSt            map[*Warnable]*remediationAttempts
+	remediationAutoResetOnce sync.Once
+}
+
+type watcherHandle struct{}
+
+// NewTracker returns a new, empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// RegisterWatcher registers cb to be called, with w and its current
+// UnhealthyState (nil if w just became healthy), every time a Warnable's
+// state changes on t. The returned func removes the registration.
+func (t *Tracker) RegisterWatcher(cb func(w *Warnable, us *UnhealthyState)) (unregister func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.watchers == nil {
+		t.watchers = make(map[*watcherHandle]func(*Warnable, *UnhealthyState))
+	}
+	h := new(watcherHandle)
+	t.watchers[h] = cb
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.watchers, h)
+	}
+}
+
+func (t *Tracker) notify(w *Warnable, us *UnhealthyState) {
+	t.mu.Lock()
+	cbs := make([]func(*Warnable, *UnhealthyState), 0, len(t.watchers))
+	for _, cb := range t.watchers {
+		cbs = append(cbs, cb)
+	}
+	t.mu.Unlock()
+	for _, cb := range cbs {
+		cb(w, us)
+	}
+}
+
+// SetUnhealthy marks w as active on t, rendering its Text from args.
+func (t *Tracker) SetUnhealthy(w *Warnable, args Args) {
+	us := &UnhealthyState{
+		WarnableCode:        w.Code,
+		Severity:            w.Severity,
+		Title:               w.Title,
+		Args:                args,
+		BrokenSince:         time.Now(),
+		ImpactsConnectivity: w.ImpactsConnectivity,
+	}
+	if w.Text != nil {
+		us.Text = w.Text(args)
+	}
+	for _, d := range w.DependsOn {
+		us.DependsOn = append(us.DependsOn, d.Code)
+	}
+
+	t.mu.Lock()
+	if t.warnableVal == nil {
+		t.warnableVal = make(map[*Warnable]*UnhealthyState)
+	}
+	t.warnableVal[w] = us
+	t.mu.Unlock()
+
+	t.notify(w, us)
+}
+
+// SetHealthy marks w as no longer active on t.
+func (t *Tracker) SetHealthy(w *Warnable) {
+	t.mu.Lock()
+	_, wasUnhealthy := t.warnableVal[w]
+	delete(t.warnableVal, w)
+	t.mu.Unlock()
+	if wasUnhealthy {
+		t.notify(w, nil)
+	}
+}
+
+// currentState returns the UnhealthyState for w on t, if it's currently
+// active.
+func (t *Tracker) currentState(w *Warnable) (_ *UnhealthyState, active bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	us, ok := t.warnableVal[w]
+	return us, ok
+}
+
+// updateState mutates the UnhealthyState for w on t in place via fn, if w is
+// currently active, and notifies watchers of the update. It's used to record
+// remediation attempts/outcomes back into the health state without treating
+// them as a fresh activation.
+func (t *Tracker) updateState(w *Warnable, fn func(*UnhealthyState)) {
+	t.mu.Lock()
+	us, ok := t.warnableVal[w]
+	if ok {
+		fn(us)
+	}
+	t.mu.Unlock()
+	if ok {
+		t.notify(w, us)
+	}
+}
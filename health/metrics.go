@@ -0,0 +1,189 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+This file exposes a Tracker's current Warnable state as Prometheus/OpenMetrics
+text, so operators can scrape node health directly instead of parsing IPN bus
+notifications.
+*/
+
+// warnableMetric tracks the Prometheus-style counters and gauges for a single
+// Warnable, across however many times it has gone active/inactive on a
+// Tracker.
+type warnableMetric struct {
+	mu             sync.Mutex
+	active         bool
+	severity       Severity
+	impactsConn    bool
+	becameActive   time.Time
+	activations    uint64
+	unhealthyTotal time.Duration
+}
+
+// seed populates m's severity/impactsConn labels from w's static
+// configuration, without touching its active/activations/unhealthyTotal
+// state. It's used to make a never-activated Warnable still emit a
+// correctly-labeled "active 0" series, rather than only appearing once it
+// first fires. A real onChange (which always carries the current, possibly
+// overridden, severity from UnhealthyState) takes precedence once it
+// happens.
+func (m *warnableMetric) seed(w *Warnable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active {
+		return
+	}
+	m.severity = w.Severity
+	m.impactsConn = w.ImpactsConnectivity
+}
+
+func (m *warnableMetric) onChange(us *UnhealthyState, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	active := us != nil
+	if active {
+		m.severity = us.Severity
+		m.impactsConn = us.ImpactsConnectivity
+	}
+	if active == m.active {
+		return
+	}
+	if active {
+		m.active = true
+		m.becameActive = now
+		m.activations++
+	} else {
+		m.unhealthyTotal += now.Sub(m.becameActive)
+		m.active = false
+	}
+}
+
+func (m *warnableMetric) snapshot(now time.Time) (active bool, sev Severity, impactsConn bool, activations uint64, unhealthySecs float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.unhealthyTotal
+	if m.active {
+		d += now.Sub(m.becameActive)
+	}
+	return m.active, m.severity, m.impactsConn, m.activations, d.Seconds()
+}
+
+// metricsCollector accumulates per-Warnable metrics for a single Tracker by
+// subscribing to its watcher feed. Its lifetime is tied to the Tracker that
+// owns it (see Tracker.metricsCollector), so it never outlives the Tracker.
+type metricsCollector struct {
+	mu     sync.Mutex
+	states map[WarnableCode]*warnableMetric
+}
+
+func (c *metricsCollector) stateFor(code WarnableCode) *warnableMetric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.states[code]
+	if !ok {
+		m = &warnableMetric{}
+		c.states[code] = m
+	}
+	return m
+}
+
+func (c *metricsCollector) onChange(w *Warnable, us *UnhealthyState) {
+	c.stateFor(w.Code).onChange(us, time.Now())
+}
+
+func (c *metricsCollector) writeTo(w io.Writer) error {
+	c.mu.Lock()
+	codes := make([]WarnableCode, 0, len(c.states))
+	for code := range c.states {
+		codes = append(codes, code)
+	}
+	c.mu.Unlock()
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+
+	now := time.Now()
+	ew := &errWriter{w: w}
+	// Per the OpenMetrics spec, a metric family's TYPE line uses the bare
+	// family name; individual counter samples carry the "_total" suffix.
+	// Families must not be interleaved, so each family's samples are
+	// collected first and written as one group after its TYPE line.
+	var activeLines, activationsLines, unhealthyLines []byte
+	for _, code := range codes {
+		m := c.stateFor(code)
+		active, sev, impactsConn, activations, unhealthySecs := m.snapshot(now)
+		labels := fmt.Sprintf("code=%q,severity=%q,impacts_connectivity=%q", code, sev, fmt.Sprint(impactsConn))
+		activeVal := 0
+		if active {
+			activeVal = 1
+		}
+		activeLines = fmt.Appendf(activeLines, "tailscaled_health_warnable_active{%s} %d\n", labels, activeVal)
+		activationsLines = fmt.Appendf(activationsLines, "tailscaled_health_warnable_activations_total{%s} %d\n", labels, activations)
+		unhealthyLines = fmt.Appendf(unhealthyLines, "tailscaled_health_warnable_unhealthy_seconds_total{%s} %f\n", labels, unhealthySecs)
+	}
+	fmt.Fprintf(ew, "# TYPE tailscaled_health_warnable_active gauge\n%s", activeLines)
+	fmt.Fprintf(ew, "# TYPE tailscaled_health_warnable_activations counter\n%s", activationsLines)
+	fmt.Fprintf(ew, "# TYPE tailscaled_health_warnable_unhealthy_seconds counter\n%s", unhealthyLines)
+	fmt.Fprintf(ew, "# EOF\n")
+	return ew.err
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+	return n, err
+}
+
+func (t *Tracker) collector() *metricsCollector {
+	t.metricsOnce.Do(func() {
+		c := &metricsCollector{states: make(map[WarnableCode]*warnableMetric)}
+		// Seed every registered Warnable up front, so a node scraped before
+		// any of them have ever fired still reports "active 0" for each
+		// instead of omitting the series entirely (which would make == 1
+		// alerting indistinguishable from a Warnable that was never wired
+		// up at all).
+		for _, w := range registeredWarnables() {
+			c.stateFor(w.Code).seed(w)
+		}
+		t.metricsCollector = c
+		t.RegisterWatcher(t.metricsCollector.onChange)
+	})
+	return t.metricsCollector
+}
+
+// MetricsHandler returns an http.Handler that renders t's current Warnable
+// state as Prometheus/OpenMetrics text: a gauge for whether each Warnable is
+// currently active, plus counters for total activations and cumulative time
+// spent unhealthy.
+//
+// Mounting it on the tsnet/localapi HTTP surfaces is left to those packages,
+// which don't exist in this tree yet; wire this handler in at the same path
+// those surfaces use for other debug/metrics endpoints once they do.
+func (t *Tracker) MetricsHandler() http.Handler {
+	c := t.collector()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		if err := c.writeTo(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsCollectorTransitions(t *testing.T) {
+	w := &Warnable{Code: "metrics-test", Severity: SeverityHigh, ImpactsConnectivity: true, Text: StaticMessage("bad")}
+	tr := NewTracker()
+	c := tr.collector()
+
+	m := c.stateFor(w.Code)
+	t0 := time.Unix(1000, 0)
+	m.onChange(nil, t0) // already healthy; no-op
+	if active, _, _, activations, secs := m.snapshot(t0); active || activations != 0 || secs != 0 {
+		t.Fatalf("expected no-op before first activation, got active=%v activations=%d secs=%v", active, activations, secs)
+	}
+
+	us := &UnhealthyState{Severity: SeverityHigh, ImpactsConnectivity: true}
+	m.onChange(us, t0)
+	if active, sev, impacts, activations, _ := m.snapshot(t0); !active || sev != SeverityHigh || !impacts || activations != 1 {
+		t.Fatalf("after activation: active=%v sev=%v impacts=%v activations=%d", active, sev, impacts, activations)
+	}
+
+	t1 := t0.Add(30 * time.Second)
+	if _, _, _, _, secs := m.snapshot(t1); secs != 30 {
+		t.Fatalf("expected 30s unhealthy while still active, got %v", secs)
+	}
+
+	m.onChange(nil, t1)
+	if active, _, _, activations, secs := m.snapshot(t1); active || activations != 1 || secs != 30 {
+		t.Fatalf("after resolution: active=%v activations=%d secs=%v", active, activations, secs)
+	}
+
+	// A second activation should bump activations but not double-count the
+	// first period's unhealthy time.
+	t2 := t1.Add(time.Minute)
+	m.onChange(&UnhealthyState{Severity: SeverityHigh}, t2)
+	if _, _, _, activations, secs := m.snapshot(t2); activations != 2 || secs != 30 {
+		t.Fatalf("after second activation: activations=%d secs=%v, want 2 and 30", activations, secs)
+	}
+}
+
+func TestMetricsCollectorSeedsNeverActivatedWarnable(t *testing.T) {
+	Register(&Warnable{Code: "metrics-seed-test", Severity: SeverityHigh, ImpactsConnectivity: true})
+	tr := NewTracker()
+	c := tr.collector()
+
+	var buf strings.Builder
+	if err := c.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	want := `tailscaled_health_warnable_active{code="metrics-seed-test",severity="high",impacts_connectivity="true"} 0`
+	if !strings.Contains(out, want) {
+		t.Errorf("output missing %q for a never-activated Warnable; got:\n%s", want, out)
+	}
+}
+
+func TestMetricsHandlerOpenMetricsFormat(t *testing.T) {
+	w := &Warnable{Code: "metrics-handler-test", Severity: SeverityMedium}
+	tr := NewTracker()
+	c := tr.collector() // must be created before the transition to observe it
+	tr.SetUnhealthy(w, Args{})
+
+	var buf strings.Builder
+	if err := c.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE tailscaled_health_warnable_active gauge\n",
+		"# TYPE tailscaled_health_warnable_activations counter\n",
+		"# TYPE tailscaled_health_warnable_unhealthy_seconds counter\n",
+		`tailscaled_health_warnable_active{code="metrics-handler-test",severity="medium",impacts_connectivity="false"} 1`,
+		`tailscaled_health_warnable_activations_total{code="metrics-handler-test",severity="medium",impacts_connectivity="false"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q; got:\n%s", want, out)
+		}
+	}
+	// A counter's TYPE line must use the bare family name, not the "_total"
+	// suffixed sample name.
+	if strings.Contains(out, "# TYPE tailscaled_health_warnable_activations_total") {
+		t.Errorf("TYPE line must not carry the _total suffix:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("output must end with # EOF, got:\n%s", out)
+	}
+}
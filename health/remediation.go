@@ -0,0 +1,194 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"errors"
+	"time"
+)
+
+/**
+This file lets subsystems attach safe, idempotent remediation actions to the
+Warnables they own (via Warnable.Remediation, defined in health.go), and lets
+a CLI or localapi caller trigger them (e.g. `tailscale debug health remediate
+<code>`) instead of only ever telling the user how to fix things themselves.
+*/
+
+// RemediationFunc performs a remediation action. It must be safe to call
+// repeatedly and concurrently with itself.
+type RemediationFunc func() error
+
+// Remediation describes an automated or suggested fix to run when its
+// Warnable becomes active. For example, noDERPHomeWarnable's Remediation
+// might trigger a DERP re-selection, and noUDP4BindWarnable's might rebind
+// the UDP socket. It's attached via Warnable.Remediation.
+type Remediation struct {
+	// Description is a short, human-readable summary of what Run does,
+	// suitable for display before a user approves running it.
+	Description string
+
+	// Run performs the remediation.
+	Run RemediationFunc
+
+	// Cooldown is the minimum time that must pass between two attempts.
+	Cooldown time.Duration
+
+	// MaxAttempts bounds how many times Run is attempted, across a single
+	// activation of the Warnable, before remediation gives up and the
+	// outcome is recorded as escalated in the Tracker's health state for
+	// that Warnable. Zero means unlimited attempts.
+	//
+	// Escalation is deliberately a health-state signal, not a change to the
+	// Warnable's static Severity: Severity describes the condition itself
+	// ("no DERP home is high severity"), while escalation describes whether
+	// self-remediation is keeping up with it. Alerting on "remediation isn't
+	// working" should watch RemediationEscalated (via Subscribe, the
+	// webhook Sink, or RemediationStatus) rather than expect Severity to
+	// change.
+	MaxAttempts int
+}
+
+// remediationAttempts is per-(Tracker, Warnable) bookkeeping: it's runtime
+// state about attempts made so far, not part of a Warnable's static
+// configuration, so it lives on the Tracker rather than on the Warnable
+// itself. This also means it's naturally scoped to the Tracker's lifetime —
+// no package-level map to leak.
+type remediationAttempts struct {
+	count     int
+	lastTry   time.Time
+	escalated bool
+}
+
+func (t *Tracker) remediationState(w *Warnable) *remediationAttempts {
+	t.remediationMu.Lock()
+	defer t.remediationMu.Unlock()
+	if t.remediationSt == nil {
+		t.remediationSt = make(map[*Warnable]*remediationAttempts)
+	}
+	a, ok := t.remediationSt[w]
+	if !ok {
+		a = &remediationAttempts{}
+		t.remediationSt[w] = a
+	}
+	return a
+}
+
+var (
+	// ErrNoRemediation is returned by Remediate/RemediateByCode when the
+	// Warnable has no registered Remediation, and by RemediateByCode when
+	// no Warnable is registered under the code.
+	ErrNoRemediation = errors.New("health: warnable has no registered remediation")
+
+	// ErrRemediationCooldown is returned when the Remediation's Cooldown
+	// has not yet elapsed since the last attempt.
+	ErrRemediationCooldown = errors.New("health: remediation attempted too recently")
+
+	// ErrRemediationEscalated is returned once a Remediation has exhausted
+	// its MaxAttempts for the current activation; the outcome has been
+	// recorded on the Tracker's health state for the Warnable (it does not
+	// change the Warnable's static Severity), and ResetRemediation or the
+	// Warnable resolving clears it.
+	ErrRemediationEscalated = errors.New("health: remediation attempts exhausted and recorded as escalated in health state")
+)
+
+// Remediate runs w.Remediation.Run, subject to its Cooldown and MaxAttempts,
+// and records the attempt count and outcome back onto t's health state for
+// w (UnhealthyState.RemediationAttempts/RemediationLastErr/
+// RemediationEscalated) so that t's watchers, including Subscribe's Events,
+// observe whether self-healing is working, without this package mutating the
+// Warnable's static Severity. The output of MetricsHandler does not include
+// remediation state.
+func (t *Tracker) Remediate(w *Warnable) error {
+	if w.Remediation == nil {
+		return ErrNoRemediation
+	}
+	r := w.Remediation
+	t.attachAutoReset()
+
+	a := t.remediationState(w)
+	t.remediationMu.Lock()
+	switch {
+	case a.escalated:
+		t.remediationMu.Unlock()
+		return ErrRemediationEscalated
+	case !a.lastTry.IsZero() && time.Since(a.lastTry) < r.Cooldown:
+		t.remediationMu.Unlock()
+		return ErrRemediationCooldown
+	}
+	a.lastTry = time.Now()
+	a.count++
+	attemptCount := a.count
+	willExhaust := r.MaxAttempts > 0 && a.count >= r.MaxAttempts
+	t.remediationMu.Unlock()
+
+	runErr := r.Run()
+
+	t.updateState(w, func(us *UnhealthyState) {
+		us.RemediationAttempts = attemptCount
+		if runErr != nil {
+			us.RemediationLastErr = runErr.Error()
+		} else {
+			us.RemediationLastErr = ""
+		}
+	})
+
+	if runErr != nil && willExhaust {
+		t.remediationMu.Lock()
+		a.escalated = true
+		t.remediationMu.Unlock()
+		t.updateState(w, func(us *UnhealthyState) {
+			us.RemediationEscalated = true
+		})
+	}
+	return runErr
+}
+
+// RemediateByCode resolves code to its registered *Warnable and calls
+// Remediate. It is the function a `tailscale debug health remediate <code>`
+// CLI invocation should call; wiring that CLI command itself is deferred, as
+// cmd/tailscale isn't part of this tree.
+func (t *Tracker) RemediateByCode(code WarnableCode) error {
+	w, ok := warnableByCode(code)
+	if !ok {
+		return ErrNoRemediation
+	}
+	return t.Remediate(w)
+}
+
+// RemediationStatus reports the outcome of past remediation attempts for w
+// on t, so callers (metrics, events, CLI output) can surface whether
+// self-healing is working or has given up.
+func (t *Tracker) RemediationStatus(w *Warnable) (attemptCount int, escalated bool, lastAttempt time.Time) {
+	t.remediationMu.Lock()
+	defer t.remediationMu.Unlock()
+	a, ok := t.remediationSt[w]
+	if !ok {
+		return 0, false, time.Time{}
+	}
+	return a.count, a.escalated, a.lastTry
+}
+
+// ResetRemediation clears the attempt count and escalation state for w on t,
+// e.g. once its Warnable has been healthy for a while. This also happens
+// automatically the next time w resolves; see attachAutoReset.
+func (t *Tracker) ResetRemediation(w *Warnable) {
+	t.remediationMu.Lock()
+	delete(t.remediationSt, w)
+	t.remediationMu.Unlock()
+}
+
+// attachAutoReset registers, once per Tracker, a watcher that clears a
+// Warnable's remediation attempt count and escalation state as soon as it
+// resolves, so the next activation gets a fresh MaxAttempts budget instead
+// of accumulating across unrelated activations.
+func (t *Tracker) attachAutoReset() {
+	t.remediationAutoResetOnce.Do(func() {
+		t.RegisterWatcher(func(w *Warnable, us *UnhealthyState) {
+			if us != nil {
+				return
+			}
+			t.ResetRemediation(w)
+		})
+	})
+}
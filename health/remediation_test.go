@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRemediateCooldown(t *testing.T) {
+	var runs int
+	w := &Warnable{
+		Code: "remediate-cooldown-test",
+		Remediation: &Remediation{
+			Run:      func() error { runs++; return nil },
+			Cooldown: time.Hour,
+		},
+	}
+	tr := NewTracker()
+	tr.SetUnhealthy(w, Args{})
+
+	if err := tr.Remediate(w); err != nil {
+		t.Fatalf("first Remediate: %v", err)
+	}
+	if err := tr.Remediate(w); err != ErrRemediationCooldown {
+		t.Fatalf("second Remediate immediately after: got %v, want ErrRemediationCooldown", err)
+	}
+	if runs != 1 {
+		t.Fatalf("Run called %d times, want 1", runs)
+	}
+}
+
+func TestRemediateMaxAttemptsEscalates(t *testing.T) {
+	failErr := errors.New("still broken")
+	w := &Warnable{
+		Code: "remediate-escalate-test",
+		Remediation: &Remediation{
+			Run:         func() error { return failErr },
+			MaxAttempts: 2,
+		},
+	}
+	tr := NewTracker()
+	tr.SetUnhealthy(w, Args{})
+
+	if err := tr.Remediate(w); err != failErr {
+		t.Fatalf("1st attempt: got %v, want %v", err, failErr)
+	}
+	if err := tr.Remediate(w); err != failErr {
+		t.Fatalf("2nd attempt: got %v, want %v", err, failErr)
+	}
+	if err := tr.Remediate(w); err != ErrRemediationEscalated {
+		t.Fatalf("3rd attempt: got %v, want ErrRemediationEscalated", err)
+	}
+
+	us, ok := tr.currentState(w)
+	if !ok {
+		t.Fatal("warnable should still be active")
+	}
+	if !us.RemediationEscalated {
+		t.Error("health state should reflect escalation")
+	}
+	if us.RemediationAttempts != 2 {
+		t.Errorf("RemediationAttempts = %d, want 2", us.RemediationAttempts)
+	}
+	if us.RemediationLastErr != failErr.Error() {
+		t.Errorf("RemediationLastErr = %q, want %q", us.RemediationLastErr, failErr.Error())
+	}
+}
+
+func TestRemediateAutoResetOnResolve(t *testing.T) {
+	calls := 0
+	w := &Warnable{
+		Code: "remediate-autoreset-test",
+		Remediation: &Remediation{
+			Run:         func() error { calls++; return errors.New("nope") },
+			MaxAttempts: 1,
+		},
+	}
+	tr := NewTracker()
+	tr.SetUnhealthy(w, Args{})
+
+	if err := tr.Remediate(w); err == nil {
+		t.Fatal("expected failure")
+	}
+	if err := tr.Remediate(w); err != ErrRemediationEscalated {
+		t.Fatalf("expected escalation, got %v", err)
+	}
+
+	// Once the Warnable resolves and re-activates, it should get a fresh
+	// attempt budget instead of staying escalated forever.
+	tr.SetHealthy(w)
+	tr.SetUnhealthy(w, Args{})
+
+	if err := tr.Remediate(w); err == nil || err == ErrRemediationEscalated {
+		t.Fatalf("after resolve+reactivate, got %v, want a fresh Run failure (not escalated)", err)
+	}
+	if calls != 2 {
+		t.Fatalf("Run called %d times, want 2", calls)
+	}
+}
+
+func TestRemediateByCodeNoRemediation(t *testing.T) {
+	tr := NewTracker()
+	if err := tr.RemediateByCode("does-not-exist"); err != ErrNoRemediation {
+		t.Fatalf("got %v, want ErrNoRemediation", err)
+	}
+}